@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/czcorpus/scollector/server"
+	"github.com/czcorpus/scollector/storage"
+)
+
+func main() {
+	listenAddr := flag.String("listen", ":8080", "address to listen on")
+	rateLimitBytes := flag.Int64("rate-limit-bytes", 0, "per-connection response rate limit in bytes/sec (0 disables limiting)")
+	cacheBytes := flag.Int64("cache-bytes", 0, "max cost of the in-process hot-query cache, in bytes (0 disables caching)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "scollector-server - serve collocations over HTTP/JSON\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] [db_path]\n\t", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	db, err := storage.OpenDBWithOptions(flag.Arg(0), storage.DBOptions{CacheBytes: *cacheBytes})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: ", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	srv := server.New(db, server.Options{RateLimitBytesPerSec: *rateLimitBytes})
+	fmt.Fprintf(os.Stderr, "listening on %s\n", *listenAddr)
+	if err := http.ListenAndServe(*listenAddr, srv.Handler()); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: ", err)
+		os.Exit(1)
+	}
+}
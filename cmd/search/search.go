@@ -11,7 +11,7 @@ import (
 
 func main() {
 	limit := flag.Int("limit", 10, "max num. of matching items to show")
-	sortBy := flag.String("sort-by", "tscore", "sorting measure (either tscore or ldice)")
+	sortBy := flag.String("sort-by", "tscore", "sorting measure - any name registered via storage.RegisterMeasure (e.g. tscore, ldice, mi, mi3, logl, dice, minsens)")
 	corpusSize := flag.Int("corpus-size", 100000000, "max num. of matching items to show")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "search - search for collocations of a provided lemma\n\n")
@@ -24,7 +24,13 @@ func main() {
 		fmt.Fprintln(os.Stderr, "ERROR: ", err)
 		os.Exit(1)
 	}
-	ans, err := db.CalculateMeasures(flag.Arg(1), *corpusSize, *limit, storage.SortingMeasure(*sortBy))
+	sortMeasure, ok := storage.LookupMeasure(*sortBy)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ERROR:  unknown sorting measure %q\n", *sortBy)
+		os.Exit(1)
+	}
+	ans, err := db.CalculateMeasures(
+		flag.Arg(1), *corpusSize, *limit, storage.SortingMeasure(*sortBy), []storage.Measure{sortMeasure})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "ERROR: ", err)
 		os.Exit(1)
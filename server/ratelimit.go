@@ -0,0 +1,105 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// emaAlpha weights how quickly monitor's transfer-rate estimate reacts to
+// the most recent Write relative to its history.
+const emaAlpha = 0.3
+
+// monitor tracks bytes written over a single connection and an
+// exponential moving average of the transfer rate, sleeping inside
+// observe whenever that average runs ahead of capBytesPerSec. This
+// mirrors the flowcontrol-style monitor used elsewhere to keep a single
+// stream from saturating the link, rather than implementing a strict
+// token bucket.
+type monitor struct {
+	mu       sync.Mutex
+	capBytes float64 // bytes/sec cap; <= 0 disables limiting
+	bytes    int64
+	samples  int64
+	emaRate  float64
+	lastObs  time.Time
+}
+
+func newMonitor(capBytesPerSec int64) *monitor {
+	return &monitor{capBytes: float64(capBytesPerSec), lastObs: time.Now()}
+}
+
+// observe records n newly written bytes and blocks the caller long enough
+// to bring the EMA transfer rate back under the configured cap.
+func (m *monitor) observe(n int) {
+	if m.capBytes <= 0 || n <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	elapsed := now.Sub(m.lastObs).Seconds()
+	if elapsed <= 0 {
+		elapsed = 0.001
+	}
+	instRate := float64(n) / elapsed
+	m.bytes += int64(n)
+	m.samples++
+	m.emaRate = emaAlpha*instRate + (1-emaAlpha)*m.emaRate
+	m.lastObs = now
+	emaRate := m.emaRate
+	overRate := emaRate - m.capBytes
+	m.mu.Unlock()
+
+	if overRate <= 0 {
+		return
+	}
+	// n/cap - n/emaRate: the extra time n bytes take at the cap compared
+	// with the estimated rate.
+	delay := time.Duration(float64(n) * overRate / (m.capBytes * emaRate) * float64(time.Second))
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// rateLimitedWriter wraps an http.ResponseWriter so that writes to it
+// are throttled to roughly capBytesPerSec bytes/sec. A capBytesPerSec of
+// zero (or less) disables throttling entirely.
+type rateLimitedWriter struct {
+	http.ResponseWriter
+	m *monitor
+}
+
+func newRateLimitedWriter(w http.ResponseWriter, capBytesPerSec int64) *rateLimitedWriter {
+	return &rateLimitedWriter{ResponseWriter: w, m: newMonitor(capBytesPerSec)}
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.m.observe(n)
+	return n, err
+}
+
+// Flush forwards to the wrapped ResponseWriter's Flush, if it supports
+// one, so NDJSON streaming can push each line out as it is written.
+func (w *rateLimitedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
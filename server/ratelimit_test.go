@@ -0,0 +1,83 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMonitorObserveDisabledWhenCapIsZero(t *testing.T) {
+	m := newMonitor(0)
+	start := time.Now()
+	m.observe(1 << 20)
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("observe with a zero cap slept for %v, want no throttling", elapsed)
+	}
+	if m.emaRate != 0 {
+		t.Errorf("emaRate = %v, want 0 (disabled monitor should not track a rate)", m.emaRate)
+	}
+}
+
+// TestMonitorObserveThrottlesOverCap backdates lastObs so a single observe
+// call sees a fixed, known elapsed time instead of whatever the test
+// happened to take, making the resulting EMA rate and sleep duration
+// deterministic.
+func TestMonitorObserveThrottlesOverCap(t *testing.T) {
+	const capBytesPerSec = 1000
+	const n = 1000
+
+	m := newMonitor(capBytesPerSec)
+	// Chosen so that observe's EMA rate comes out to ~1100 bytes/sec,
+	// 10% over the cap, which (with n == capBytesPerSec) works out to a
+	// ~100ms sleep - long enough to reliably measure, short enough to
+	// keep the test fast.
+	const elapsedSeconds = 300.0 / 1100.0
+	m.lastObs = time.Now().Add(-time.Duration(elapsedSeconds * float64(time.Second)))
+
+	start := time.Now()
+	m.observe(n)
+	elapsed := time.Since(start)
+
+	if elapsed < 50*time.Millisecond {
+		t.Errorf("observe over the cap returned after %v, want it to block for roughly 100ms", elapsed)
+	}
+	if elapsed > time.Second {
+		t.Errorf("observe over the cap blocked for %v, want well under 1s", elapsed)
+	}
+	if m.emaRate <= capBytesPerSec {
+		t.Errorf("emaRate = %v after an over-cap write, want it above the %d bytes/sec cap", m.emaRate, capBytesPerSec)
+	}
+}
+
+func TestRateLimitedWriterForwardsWritesAndFlush(t *testing.T) {
+	rr := httptest.NewRecorder()
+	w := newRateLimitedWriter(rr, 0)
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	w.Flush()
+
+	if got := rr.Body.String(); got != "hello" {
+		t.Errorf("underlying writer received %q, want %q", got, "hello")
+	}
+	if !rr.Flushed {
+		t.Errorf("Flush did not reach the underlying ResponseWriter")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server exposes a storage.DB over HTTP/JSON:
+//
+//	GET /collocations?lemma=...&limit=...&sort=...&corpus_size=...
+//	GET /lemmas?prefix=...
+//	GET /stats
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/czcorpus/scollector/storage"
+)
+
+const ndjsonMediaType = "application/x-ndjson"
+
+const (
+	defaultLimit      = 10
+	defaultSortBy     = "tscore"
+	defaultCorpusSize = 100000000
+)
+
+// Options configures a Server.
+type Options struct {
+	// RateLimitBytesPerSec caps, per connection, how fast a response may
+	// be written. Zero (the default) disables rate limiting.
+	RateLimitBytesPerSec int64
+}
+
+// Server mounts a storage.DB behind a small HTTP API.
+type Server struct {
+	db   *storage.DB
+	opts Options
+}
+
+// New creates a Server backed by db.
+func New(db *storage.DB, opts Options) *Server {
+	return &Server{db: db, opts: opts}
+}
+
+// Handler returns the http.Handler routing the server's endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/collocations", s.handleCollocations)
+	mux.HandleFunc("/lemmas", s.handleLemmas)
+	mux.HandleFunc("/stats", s.handleStats)
+	return mux
+}
+
+func (s *Server) newResponseWriter(w http.ResponseWriter) *rateLimitedWriter {
+	return newRateLimitedWriter(w, s.opts.RateLimitBytesPerSec)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func intQueryParam(r *http.Request, name string, def int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+// handleCollocations serves GET /collocations?lemma=...&limit=...&sort=...&corpus_size=...
+//
+// With "Accept: application/x-ndjson" it streams one JSON-encoded
+// storage.Collocation per line as each is scored, rather than waiting for
+// the full, sorted result set - see storage.DB.CalculateMeasuresStream.
+// Otherwise it returns the full sorted result as a single JSON array.
+func (s *Server) handleCollocations(w http.ResponseWriter, r *http.Request) {
+	lemma := r.URL.Query().Get("lemma")
+	if lemma == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing required parameter: lemma"))
+		return
+	}
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = defaultSortBy
+	}
+	measure, ok := storage.LookupMeasure(sortBy)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown sorting measure %q", sortBy))
+		return
+	}
+	limit, err := intQueryParam(r, "limit", defaultLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %w", err))
+		return
+	}
+	if limit < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: must not be negative"))
+		return
+	}
+	corpusSize, err := intQueryParam(r, "corpus_size", defaultCorpusSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid corpus_size: %w", err))
+		return
+	}
+	if corpusSize < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid corpus_size: must not be negative"))
+		return
+	}
+
+	rw := s.newResponseWriter(w)
+
+	if r.Header.Get("Accept") == ndjsonMediaType {
+		rw.Header().Set("Content-Type", ndjsonMediaType)
+		enc := json.NewEncoder(rw)
+		err := s.db.CalculateMeasuresStream(
+			lemma, corpusSize, limit, storage.SortingMeasure(sortBy), []storage.Measure{measure},
+			func(c storage.Collocation) error {
+				if err := enc.Encode(c); err != nil {
+					return err
+				}
+				rw.Flush()
+				return nil
+			},
+		)
+		if err != nil {
+			// A response may already be partially written at this point,
+			// so there is nothing better to do than stop.
+			return
+		}
+		return
+	}
+
+	results, err := s.db.CalculateMeasures(lemma, corpusSize, limit, storage.SortingMeasure(sortBy), []storage.Measure{measure})
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(results)
+}
+
+// lemmaEntry is the /lemmas response shape.
+type lemmaEntry struct {
+	Value   string `json:"value"`
+	TokenID uint32 `json:"tokenId"`
+}
+
+// handleLemmas serves GET /lemmas?prefix=...
+func (s *Server) handleLemmas(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing required parameter: prefix"))
+		return
+	}
+	matches, err := s.db.GetLemmaIDsByPrefix(prefix)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	entries := make([]lemmaEntry, len(matches))
+	for i, m := range matches {
+		entries[i] = lemmaEntry{Value: m.Value, TokenID: m.TokenID}
+	}
+
+	rw := s.newResponseWriter(w)
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(entries)
+}
+
+// handleStats serves GET /stats
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	rw := s.newResponseWriter(w)
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(s.db.Stats())
+}
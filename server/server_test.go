@@ -0,0 +1,167 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/scollector/storage"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	return newTestServerWithOptions(t, Options{})
+}
+
+func newTestServerWithOptions(t *testing.T, opts Options) *Server {
+	t.Helper()
+	db, err := storage.OpenDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tidSeq := storage.NewTokenIDSequence()
+	err = db.StoreData(
+		tidSeq,
+		map[string]int{"dog_NN": 100, "bark_VB": 50, "run_VB": 30},
+		map[[2]string]int{{"dog_NN", "bark_VB"}: 20, {"dog_NN", "run_VB"}: 10},
+		1,
+	)
+	if err != nil {
+		t.Fatalf("StoreData failed: %v", err)
+	}
+	return New(db, opts)
+}
+
+func TestHandleCollocationsRejectsNegativeLimit(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/collocations?lemma=dog_NN&limit=-1", nil)
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d for a negative limit", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleCollocationsRejectsNegativeCorpusSize(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/collocations?lemma=dog_NN&corpus_size=-1", nil)
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d for a negative corpus_size", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleCollocationsRejectsMissingLemma(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/collocations", nil)
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d for a missing lemma", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleCollocationsReturnsResults(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/collocations?lemma=dog_NN", nil)
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", rr.Header().Get("Content-Type"))
+	}
+
+	var results []storage.Collocation
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("response body is not a JSON array: %v; body: %s", err, rr.Body.String())
+	}
+	if len(results) != 2 {
+		t.Errorf("got %d collocations, want 2", len(results))
+	}
+}
+
+// TestHandleCollocationsStreamsNDJSON covers the "Accept:
+// application/x-ndjson" branch of handleCollocations, which
+// TestHandleCollocationsReturnsResults and friends never exercise since
+// they don't set that header.
+func TestHandleCollocationsStreamsNDJSON(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/collocations?lemma=dog_NN", nil)
+	req.Header.Set("Accept", ndjsonMediaType)
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); got != ndjsonMediaType {
+		t.Errorf("Content-Type = %q, want %q", got, ndjsonMediaType)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(rr.Body.Bytes()))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanning NDJSON body failed: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d NDJSON lines, want 2; body: %s", len(lines), rr.Body.String())
+	}
+	for _, line := range lines {
+		var c storage.Collocation
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			t.Errorf("line %q is not a valid JSON-encoded Collocation: %v", line, err)
+		}
+	}
+}
+
+// TestHandleCollocationsAppliesRateLimit checks that a configured
+// RateLimitBytesPerSec reaches the response writer used by
+// handleCollocations, without asserting on wall-clock timing - the EMA
+// throttling math itself is covered deterministically by
+// TestMonitorObserveThrottlesOverCap in ratelimit_test.go.
+func TestHandleCollocationsAppliesRateLimit(t *testing.T) {
+	srv := newTestServerWithOptions(t, Options{RateLimitBytesPerSec: 64})
+	req := httptest.NewRequest(http.MethodGet, "/collocations?lemma=dog_NN", nil)
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var results []storage.Collocation
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("response body is not a JSON array: %v; body: %s", err, rr.Body.String())
+	}
+	if len(results) != 2 {
+		t.Errorf("got %d collocations under a byte-rate cap, want 2 (the cap should throttle writes, not drop data)", len(results))
+	}
+}
@@ -17,6 +17,11 @@
 package storage
 
 import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring"
 	"github.com/dgraph-io/badger/v4"
 )
 
@@ -24,6 +29,31 @@ import (
 // methods for adding/retrieving collocation information.
 type DB struct {
 	bdb *badger.DB
+	dir string
+
+	// wal and headBlock back the ingestion pipeline exposed via
+	// NewIngestor/Compact.
+	wal       *walWriter
+	headBlock *headBlock
+
+	// filterMu guards collocateFilters
+	filterMu sync.Mutex
+	// collocateFilters holds optional per-head-lemma collocate
+	// restrictions set via SetCollocateFilter.
+	collocateFilters map[uint32]*roaring.Bitmap
+
+	// cache is the optional hot-query cache configured via
+	// OpenDBWithOptions. A nil cache is valid (always-miss).
+	cache                  *queryCache
+	cacheHits, cacheMisses atomic.Uint64
+
+	// tokenIDHighWaterMark is the highest tokenID assigned so far, seeded
+	// from the reverse lemma index at open time (see scanMaxTokenID).
+	// NewIngestor draws new tokenIDs from it so that a second ingestion
+	// session against an already-populated DB (e.g. after a restart, or
+	// just a second NewIngestor call in the same process) never reuses an
+	// ID already owned by another lemma.
+	tokenIDHighWaterMark atomic.Uint32
 }
 
 // Close closes the internal Badger database.
@@ -33,7 +63,15 @@ type DB struct {
 // or on an uninitialized DB object, in which case
 // it is a NOP.
 func (db *DB) Close() error {
-	if db != nil && db.bdb != nil {
+	if db == nil {
+		return nil
+	}
+	if db.wal != nil {
+		if err := db.wal.close(); err != nil {
+			return err
+		}
+	}
+	if db.bdb != nil {
 		return db.bdb.Close()
 	}
 	return nil
@@ -46,3 +84,27 @@ func (db *DB) Flush() error {
 func (db *DB) Size() (int64, int64) {
 	return db.bdb.Size()
 }
+
+// scanMaxTokenID returns the highest tokenID present in the reverse lemma
+// index (IDToLemmaPrefix), or 0 if the DB has no lemmas yet.
+func scanMaxTokenID(bdb *badger.DB) (uint32, error) {
+	var max uint32
+	err := bdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		prefix := []byte{IDToLemmaPrefix}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().Key()
+			if len(key) != 5 {
+				continue
+			}
+			if id := binary.LittleEndian.Uint32(key[1:5]); id > max {
+				max = id
+			}
+		}
+		return nil
+	})
+	return max, err
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// bitmapChunkSize is the number of collocates held by a single frequency
+// vector chunk. Chunk boundaries follow the ascending tokenID order in
+// which the head lemma's Roaring bitmap stores its collocates, so a
+// collocate's rank within the bitmap always resolves to the same
+// (chunkID, offset) pair.
+const bitmapChunkSize = 1024
+
+// storeBitmapIndexTx (re)builds the Roaring bitmap and frequency vector
+// chunks for a single head lemma. It rewrites the head's whole index from
+// collocates, so collocates must hold every collocate of the head (callers
+// merge new frequencies into the loaded ones first), not just new ones.
+func (db *DB) storeBitmapIndexTx(txn *badger.Txn, headID uint32, collocates map[uint32]uint32) error {
+	ids := make([]uint32, 0, len(collocates))
+	for id := range collocates {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	bm := roaring.New()
+	for _, id := range ids {
+		bm.Add(id)
+	}
+	var buf bytes.Buffer
+	if _, err := bm.WriteTo(&buf); err != nil {
+		return fmt.Errorf("failed to serialize bitmap index for head %d: %w", headID, err)
+	}
+	if err := txn.Set(encodeBitmapIndexKey(headID), buf.Bytes()); err != nil {
+		return err
+	}
+
+	for chunkStart := 0; chunkStart < len(ids); chunkStart += bitmapChunkSize {
+		chunkEnd := chunkStart + bitmapChunkSize
+		if chunkEnd > len(ids) {
+			chunkEnd = len(ids)
+		}
+		chunkIDs := ids[chunkStart:chunkEnd]
+		freqs := make([]uint32, len(chunkIDs))
+		for i, id := range chunkIDs {
+			freqs[i] = collocates[id]
+		}
+		chunkID := uint32(chunkStart / bitmapChunkSize)
+		if err := txn.Set(encodeFreqVectorKey(headID, chunkID), encodeFreqVector(freqs)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getBitmapIndexTxn loads the full (unfiltered) collocate bitmap for a head
+// lemma, within an existing transaction.
+func (db *DB) getBitmapIndexTxn(txn *badger.Txn, headID uint32) (*roaring.Bitmap, error) {
+	item, err := txn.Get(encodeBitmapIndexKey(headID))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	bm := roaring.New()
+	if _, err := bm.ReadFrom(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("failed to decode bitmap index for head %d: %w", headID, err)
+	}
+	return bm, nil
+}
+
+// getFreqVectorTxn loads and decodes a single frequency vector chunk for a
+// head lemma, within an existing transaction.
+func (db *DB) getFreqVectorTxn(txn *badger.Txn, headID, chunkID uint32) ([]uint32, error) {
+	item, err := txn.Get(encodeFreqVectorKey(headID, chunkID))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFreqVector(raw)
+}
+
+// loadCollocatesTxn reconstructs the full per-collocate frequency map for a
+// head lemma from its current bitmap index and frequency vector chunks.
+// It returns badger.ErrKeyNotFound (with a nil map) if the head has no
+// bitmap index yet.
+func (db *DB) loadCollocatesTxn(txn *badger.Txn, headID uint32) (map[uint32]uint32, error) {
+	bm, err := db.getBitmapIndexTxn(txn, headID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[uint32]uint32, bm.GetCardinality())
+	it := bm.Iterator()
+	for chunkID := uint32(0); it.HasNext(); chunkID++ {
+		freqs, err := db.getFreqVectorTxn(txn, headID, chunkID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load frequency vector chunk %d for head %d: %w", chunkID, headID, err)
+		}
+		for offset := 0; offset < len(freqs) && it.HasNext(); offset++ {
+			id := it.Next()
+			stats[id] = freqs[offset]
+		}
+	}
+	return stats, nil
+}
+
+// SetCollocateFilter pre-restricts subsequent CalculateMeasures lookups for
+// headLemma to the provided set of collocate tokenIDs (e.g. a POS class or
+// a user-supplied lemma list). The filter is applied as a cheap Roaring
+// bitmap intersection ("And") against the head lemma's posting list.
+// Passing a nil or empty filterIDs clears any previously set filter. Since
+// the query cache's keys don't encode the active filter, changing it
+// invalidates the whole cache so no stale unfiltered/differently-filtered
+// result can be served afterwards.
+func (db *DB) SetCollocateFilter(headLemma string, filterIDs []uint32) error {
+	headID, err := db.GetLemmaID(headLemma)
+	if err != nil {
+		return fmt.Errorf("failed to set collocate filter for %q: %w", headLemma, err)
+	}
+
+	db.filterMu.Lock()
+	if len(filterIDs) == 0 {
+		delete(db.collocateFilters, headID)
+	} else {
+		filter := roaring.New()
+		filter.AddMany(filterIDs)
+		db.collocateFilters[headID] = filter
+	}
+	db.filterMu.Unlock()
+
+	db.cache.invalidateAll()
+	return nil
+}
+
+// collocateFilterFor returns the currently configured collocate filter for
+// a head lemma, or nil if none was set via SetCollocateFilter.
+func (db *DB) collocateFilterFor(headID uint32) *roaring.Bitmap {
+	db.filterMu.Lock()
+	defer db.filterMu.Unlock()
+	return db.collocateFilters[headID]
+}
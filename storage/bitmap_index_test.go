@@ -0,0 +1,90 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestStoreAndLoadBitmapIndexRoundtrip(t *testing.T) {
+	db, err := OpenDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	const headID = uint32(1)
+	want := map[uint32]uint32{
+		10: 5,
+		20: 7,
+	}
+	err = db.bdb.Update(func(txn *badger.Txn) error {
+		return db.storeBitmapIndexTx(txn, headID, want)
+	})
+	if err != nil {
+		t.Fatalf("storeBitmapIndexTx failed: %v", err)
+	}
+
+	var got map[uint32]uint32
+	err = db.bdb.View(func(txn *badger.Txn) error {
+		var err error
+		got, err = db.loadCollocatesTxn(txn, headID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("loadCollocatesTxn failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d collocates, want %d", len(got), len(want))
+	}
+	for id, stats := range want {
+		if got[id] != stats {
+			t.Errorf("collocate %d: got %+v, want %+v", id, got[id], stats)
+		}
+	}
+}
+
+func TestIncrementPairTokenFreqUpdatesBitmapIndex(t *testing.T) {
+	db, err := OpenDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	const headID, collocateID = uint32(1), uint32(2)
+	if err := db.IncrementPairTokenFreq(headID, collocateID, 3); err != nil {
+		t.Fatalf("IncrementPairTokenFreq failed: %v", err)
+	}
+	if err := db.IncrementPairTokenFreq(headID, collocateID, 4); err != nil {
+		t.Fatalf("IncrementPairTokenFreq failed: %v", err)
+	}
+
+	var stats map[uint32]uint32
+	err = db.bdb.View(func(txn *badger.Txn) error {
+		var err error
+		stats, err = db.loadCollocatesTxn(txn, headID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("loadCollocatesTxn failed: %v", err)
+	}
+	if got, want := stats[collocateID], uint32(7); got != want {
+		t.Errorf("collocate freq = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+)
+
+// DBOptions configures behavior layered on top of the raw Badger storage
+// by OpenDBWithOptions.
+type DBOptions struct {
+	// CacheBytes is the max cost (approximately, bytes) the in-process
+	// query cache may hold. Zero (the default) disables caching.
+	CacheBytes int64
+	// CacheNumCounters sizes Ristretto's admission sketch. Ristretto
+	// recommends roughly 10x the number of items expected to be held at
+	// once; a zero value derives a ballpark figure from CacheBytes.
+	CacheNumCounters int64
+	// CacheTTL expires cached entries after this long regardless of
+	// admission pressure. Zero means entries never expire on their own.
+	CacheTTL time.Duration
+}
+
+// queryCache memoises hot lemma/collocation lookups in front of Badger.
+// A nil *queryCache is valid and behaves as an always-miss, always-empty
+// cache, so callers don't need to special-case "caching disabled".
+type queryCache struct {
+	rc  *ristretto.Cache
+	ttl time.Duration
+}
+
+func newQueryCache(opts DBOptions) (*queryCache, error) {
+	if opts.CacheBytes <= 0 {
+		return nil, nil
+	}
+	numCounters := opts.CacheNumCounters
+	if numCounters <= 0 {
+		numCounters = opts.CacheBytes / 8 * 10
+	}
+	rc, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: numCounters,
+		MaxCost:     opts.CacheBytes,
+		BufferItems: 64,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create query cache: %w", err)
+	}
+	return &queryCache{rc: rc, ttl: opts.CacheTTL}, nil
+}
+
+func (c *queryCache) get(key string) (any, bool) {
+	if c == nil {
+		return nil, false
+	}
+	return c.rc.Get(key)
+}
+
+func (c *queryCache) set(key string, value any, cost int64) {
+	if c == nil {
+		return
+	}
+	if c.ttl > 0 {
+		c.rc.SetWithTTL(key, value, cost, c.ttl)
+	} else {
+		c.rc.Set(key, value, cost)
+	}
+}
+
+// invalidateAll drops every cached entry. Used whenever ingestion mutates
+// the underlying data, since individual cache keys don't track which
+// lemmas/pairs they depend on.
+func (c *queryCache) invalidateAll() {
+	if c == nil {
+		return
+	}
+	c.rc.Clear()
+}
+
+func lemmaIDCacheKey(lemma string) string {
+	return "lid:" + lemma
+}
+
+func lemmaByIDCacheKey(tokenID uint32) string {
+	return fmt.Sprintf("lbid:%d", tokenID)
+}
+
+func singleFreqCacheKey(tokenID uint32) string {
+	return fmt.Sprintf("sf:%d", tokenID)
+}
+
+// measuresCacheKey identifies a CalculateMeasures call by every argument
+// that affects its result, including the requested measure set (since
+// "mi,tscore" and "tscore" must not collide).
+func measuresCacheKey(lemma string, corpusSize, limit int, sortBy SortingMeasure, measures []Measure) string {
+	h := fnv.New64a()
+	for _, m := range measures {
+		io.WriteString(h, m.Name())
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("cm:%s:%d:%d:%s:%x", lemma, corpusSize, limit, sortBy, h.Sum64())
+}
+
+// CacheStats reports cumulative hit/miss counts for the query cache.
+// When the DB was opened without a cache, Hits stays zero and every
+// lookup is counted as a miss.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// Stats returns the query cache's cumulative hit/miss counters, letting
+// operators size CacheBytes/CacheNumCounters for their workload.
+func (db *DB) Stats() CacheStats {
+	return CacheStats{
+		Hits:   db.cacheHits.Load(),
+		Misses: db.cacheMisses.Load(),
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewQueryCacheDisabledWhenCacheBytesIsZero(t *testing.T) {
+	c, err := newQueryCache(DBOptions{})
+	if err != nil {
+		t.Fatalf("newQueryCache failed: %v", err)
+	}
+	if c != nil {
+		t.Fatalf("newQueryCache with CacheBytes=0 should return a nil cache")
+	}
+	// A nil cache must behave as an always-miss, always-empty cache
+	// rather than panicking.
+	if _, ok := c.get("key"); ok {
+		t.Errorf("get() on a nil cache reported a hit")
+	}
+	c.set("key", "value", 1)
+	c.invalidateAll()
+}
+
+func TestQueryCacheSetAndGet(t *testing.T) {
+	c, err := newQueryCache(DBOptions{CacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("newQueryCache failed: %v", err)
+	}
+	if c == nil {
+		t.Fatal("newQueryCache with CacheBytes>0 returned a nil cache")
+	}
+	c.set("key", 42, 1)
+	c.rc.Wait()
+	v, ok := c.get("key")
+	if !ok {
+		t.Fatal("get() after set() reported a miss")
+	}
+	if v.(int) != 42 {
+		t.Errorf("get() = %v, want 42", v)
+	}
+
+	c.invalidateAll()
+	if _, ok := c.get("key"); ok {
+		t.Errorf("get() after invalidateAll() reported a hit")
+	}
+}
+
+func TestQueryCacheTTLExpiry(t *testing.T) {
+	c, err := newQueryCache(DBOptions{CacheBytes: 1 << 20, CacheTTL: time.Millisecond})
+	if err != nil {
+		t.Fatalf("newQueryCache failed: %v", err)
+	}
+	c.set("key", 1, 1)
+	c.rc.Wait()
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := c.get("key"); ok {
+		t.Errorf("get() returned a hit for an entry past its TTL")
+	}
+}
+
+func TestCalculateMeasuresCacheHitsAndMisses(t *testing.T) {
+	db, err := OpenDBWithOptions(t.TempDir(), DBOptions{CacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("OpenDBWithOptions failed: %v", err)
+	}
+	defer db.Close()
+
+	tidSeq := NewTokenIDSequence()
+	err = db.StoreData(
+		tidSeq,
+		map[string]int{"dog_NN": 100, "bark_VB": 50},
+		map[[2]string]int{{"dog_NN", "bark_VB"}: 20},
+		1,
+	)
+	if err != nil {
+		t.Fatalf("StoreData failed: %v", err)
+	}
+
+	measure, ok := LookupMeasure("tscore")
+	if !ok {
+		t.Fatal("measure \"tscore\" not registered")
+	}
+	if _, err := db.CalculateMeasures("dog_NN", 1000000, 10, "tscore", []Measure{measure}); err != nil {
+		t.Fatalf("CalculateMeasures failed: %v", err)
+	}
+	db.cache.rc.Wait()
+	missesAfterFirstCall := db.Stats().Misses
+
+	if _, err := db.CalculateMeasures("dog_NN", 1000000, 10, "tscore", []Measure{measure}); err != nil {
+		t.Fatalf("CalculateMeasures failed: %v", err)
+	}
+
+	stats := db.Stats()
+	if stats.Hits != 1 {
+		t.Errorf("cache hits = %d, want 1 (second, identical call should hit the top-level measures cache)", stats.Hits)
+	}
+	if stats.Misses != missesAfterFirstCall {
+		t.Errorf("cache misses grew from %d to %d on a repeat call; the measures cache should short-circuit before any nested lookups",
+			missesAfterFirstCall, stats.Misses)
+	}
+}
+
+func TestSetCollocateFilterInvalidatesCachedMeasures(t *testing.T) {
+	db, err := OpenDBWithOptions(t.TempDir(), DBOptions{CacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("OpenDBWithOptions failed: %v", err)
+	}
+	defer db.Close()
+
+	tidSeq := NewTokenIDSequence()
+	err = db.StoreData(
+		tidSeq,
+		map[string]int{"dog_NN": 100, "bark_VB": 50, "run_VB": 30},
+		map[[2]string]int{{"dog_NN", "bark_VB"}: 20, {"dog_NN", "run_VB"}: 10},
+		1,
+	)
+	if err != nil {
+		t.Fatalf("StoreData failed: %v", err)
+	}
+
+	measure, ok := LookupMeasure("tscore")
+	if !ok {
+		t.Fatal("measure \"tscore\" not registered")
+	}
+	results, err := db.CalculateMeasures("dog_NN", 1000000, 10, "tscore", []Measure{measure})
+	if err != nil {
+		t.Fatalf("CalculateMeasures failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d collocates before filtering, want 2", len(results))
+	}
+	db.cache.rc.Wait()
+
+	barkID, err := db.GetLemmaID("bark_VB")
+	if err != nil {
+		t.Fatalf("GetLemmaID failed: %v", err)
+	}
+	if err := db.SetCollocateFilter("dog_NN", []uint32{barkID}); err != nil {
+		t.Fatalf("SetCollocateFilter failed: %v", err)
+	}
+
+	results, err = db.CalculateMeasures("dog_NN", 1000000, 10, "tscore", []Measure{measure})
+	if err != nil {
+		t.Fatalf("CalculateMeasures failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d collocates after SetCollocateFilter, want 1 (stale cached result was served)", len(results))
+	}
+	if results[0].RawCollocate != "bark_VB" {
+		t.Errorf("filtered collocate = %q, want %q", results[0].RawCollocate, "bark_VB")
+	}
+}
@@ -18,16 +18,18 @@ package storage
 
 import (
 	"encoding/binary"
+	"fmt"
 	"strings"
 )
 
 const (
 	LemmaToIDPrefix    byte = 0x00 // "lemma" -> tokenID
 	SingleTokenPrefix  byte = 0x01 // tokenID -> frequency
-	PairTokenPrefix    byte = 0x02 // (tokenID1, tokenID2) -> frequency
 	IDToLemmaPrefix    byte = 0x03 // tokenID -> "lemma" (reverse lookup)
 	PoSLemmaToIDPrefix byte = 0x04 // "lemma + PoS" -> tokenID
 	IDToPoSLemmaPrefix byte = 0x05 // tokenID -> "lemma + PoS" (reverse lookup)
+	BitmapIndexPrefix  byte = 0x06 // headID -> Roaring bitmap of collocate tokenIDs
+	FreqVectorPrefix   byte = 0x07 // (headID, chunkID) -> packed pair-frequency vector
 )
 
 // encodeLemmaKey creates a byte key representation for Lemma -> Lemma ID entries
@@ -49,42 +51,12 @@ func decodeFrequency(data []byte) uint32 {
 	return binary.LittleEndian.Uint32(data)
 }
 
-func decodeFrequencyAndDist(data []byte) (uint32, uint16) {
-	return binary.LittleEndian.Uint32(data[:4]), binary.LittleEndian.Uint16(data[4:])
-}
-
-func mutualPositionToInt(v uint16) int {
-	return 32768 - int(v)
-}
-
-func mutualPositionToUint16(v int) uint16 {
-	if v > 16384 {
-		panic("cannot encode position - distance overflow")
-	}
-	return uint16(32768 + v)
-}
-
 func encodeFrequency(freq uint32) []byte {
 	buf := make([]byte, 4)
 	binary.LittleEndian.PutUint32(buf, freq)
 	return buf
 }
 
-func encodeFrequencyAndDist(freq uint32, dist uint16) []byte {
-	buf := make([]byte, 6)
-	binary.LittleEndian.PutUint32(buf[:4], freq)
-	binary.LittleEndian.PutUint16(buf[4:], dist)
-	return buf
-}
-
-func encodePairTokenKey(token1ID, token2ID uint32) []byte {
-	key := make([]byte, 9)
-	key[0] = PairTokenPrefix
-	binary.LittleEndian.PutUint32(key[1:5], token1ID)
-	binary.LittleEndian.PutUint32(key[5:9], token2ID)
-	return key
-}
-
 func tokenIDToKey(tokenID uint32) []byte {
 	key := make([]byte, 5)
 	key[0] = SingleTokenPrefix
@@ -105,3 +77,46 @@ func tokenIDToRIKey(tokenID uint32) []byte {
 	binary.LittleEndian.PutUint32(key[1:5], tokenID)
 	return key
 }
+
+// encodeBitmapIndexKey creates a key for the per-head-lemma Roaring bitmap
+// of collocate tokenIDs.
+func encodeBitmapIndexKey(headID uint32) []byte {
+	key := make([]byte, 5)
+	key[0] = BitmapIndexPrefix
+	binary.LittleEndian.PutUint32(key[1:5], headID)
+	return key
+}
+
+// encodeFreqVectorKey creates a key for a single chunk of a head lemma's
+// frequency vector (see encodeFreqVector).
+func encodeFreqVectorKey(headID, chunkID uint32) []byte {
+	key := make([]byte, 9)
+	key[0] = FreqVectorPrefix
+	binary.LittleEndian.PutUint32(key[1:5], headID)
+	binary.LittleEndian.PutUint32(key[5:9], chunkID)
+	return key
+}
+
+// encodeFreqVector packs the pair frequencies of a frequency-vector chunk
+// (in bitmap iteration order, i.e. ascending collocate tokenID) into a
+// single value blob.
+func encodeFreqVector(freqs []uint32) []byte {
+	buf := make([]byte, len(freqs)*4)
+	for i, freq := range freqs {
+		binary.LittleEndian.PutUint32(buf[i*4:i*4+4], freq)
+	}
+	return buf
+}
+
+// decodeFreqVector is the inverse of encodeFreqVector.
+func decodeFreqVector(data []byte) ([]uint32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid frequency vector length: %d", len(data))
+	}
+	numItems := len(data) / 4
+	freqs := make([]uint32, numItems)
+	for i := 0; i < numItems; i++ {
+		freqs[i] = binary.LittleEndian.Uint32(data[i*4 : i*4+4])
+	}
+	return freqs, nil
+}
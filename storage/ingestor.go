@@ -0,0 +1,296 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// defaultBatchSize and defaultNumWorkers are used by DefaultIngestorOpts.
+const (
+	defaultBatchSize  = 10000
+	defaultNumWorkers = 4
+)
+
+// IngestorOpts configures the flush behavior of an Ingestor.
+type IngestorOpts struct {
+	// BatchSize is the number of head-block records that triggers an
+	// automatic Flush.
+	BatchSize int
+	// NumWorkers is the number of parallel Badger WriteBatch workers used
+	// by Flush.
+	NumWorkers int
+	// SyncWrites fsyncs the WAL after every appended record. This trades
+	// ingestion throughput for a tighter crash-recovery window.
+	SyncWrites bool
+}
+
+// DefaultIngestorOpts returns reasonable defaults for bulk corpus ingestion.
+func DefaultIngestorOpts() IngestorOpts {
+	return IngestorOpts{
+		BatchSize:  defaultBatchSize,
+		NumWorkers: defaultNumWorkers,
+	}
+}
+
+// headBlock is the in-memory accumulator of WAL records awaiting a flush
+// to Badger. It lives on DB (not on an individual Ingestor) because the
+// WAL itself is a single, DB-wide append-only file.
+type headBlock struct {
+	mu      sync.Mutex
+	records []walRecord
+}
+
+func (hb *headBlock) add(rec walRecord) int {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.records = append(hb.records, rec)
+	return len(hb.records)
+}
+
+func (hb *headBlock) drain() []walRecord {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	records := hb.records
+	hb.records = nil
+	return records
+}
+
+// Ingestor is a write-side handle onto a DB's ingestion pipeline: it logs
+// every added lemma/single-freq/pair-freq record to the WAL immediately
+// (for crash recovery) and lets the DB's head block batch them into
+// Badger using WriteBatch, rather than one transaction per record.
+//
+// An Ingestor is not safe for concurrent use by multiple goroutines -
+// create one per ingestion worker/goroutine and call Close when done.
+type Ingestor struct {
+	db     *DB
+	opts   IngestorOpts
+	tidSeq *tokenIDSequence
+}
+
+// NewIngestor creates an Ingestor bound to db. The returned Ingestor
+// shares db's WAL and head block with any other ingestor created against
+// the same DB, and draws new tokenIDs from db's shared high-water mark
+// (seeded from the DB's existing lemmas at open time), so a second
+// NewIngestor session against an already-populated DB - including after
+// a restart - cannot reassign a tokenID already owned by another lemma.
+func (db *DB) NewIngestor(opts IngestorOpts) *Ingestor {
+	return db.newIngestorWithSeq(opts, db.newDBTokenIDSequence())
+}
+
+// newIngestorWithSeq is like NewIngestor but lets the caller supply its own
+// tokenIDSequence, e.g. one shared with other code through several
+// ingestion passes. StoreData uses this to stay behavior-compatible with
+// callers that already manage their own sequence.
+func (db *DB) newIngestorWithSeq(opts IngestorOpts, tidSeq *tokenIDSequence) *Ingestor {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.NumWorkers <= 0 {
+		opts.NumWorkers = defaultNumWorkers
+	}
+	return &Ingestor{db: db, opts: opts, tidSeq: tidSeq}
+}
+
+// AddLemma registers a lemma, assigning it a new tokenID. Subsequent calls
+// to AddSingle/AddPair for the same lemma (on this Ingestor) resolve that
+// tokenID via the Ingestor's own sequence cache.
+func (ing *Ingestor) AddLemma(lemma string) error {
+	tokenID := ing.tidSeq.next(lemma)
+	return ing.log(walRecord{recType: walRecordLemma, tokenID: tokenID, lemma: lemma})
+}
+
+// AddSingle records a single-token frequency for a lemma previously passed
+// to AddLemma.
+func (ing *Ingestor) AddSingle(lemma string, freq uint32) error {
+	tokenID := ing.tidSeq.recall(lemma)
+	return ing.log(walRecord{recType: walRecordSingle, tokenID: tokenID, freq: freq})
+}
+
+// AddPair records a pair frequency between two lemmas previously passed to
+// AddLemma.
+func (ing *Ingestor) AddPair(lemma1, lemma2 string, freq uint32) error {
+	return ing.log(walRecord{
+		recType:  walRecordPair,
+		tokenID:  ing.tidSeq.recall(lemma1),
+		tokenID2: ing.tidSeq.recall(lemma2),
+		freq:     freq,
+	})
+}
+
+func (ing *Ingestor) log(rec walRecord) error {
+	rec, err := ing.db.wal.append(rec)
+	if err != nil {
+		return err
+	}
+	if ing.opts.SyncWrites {
+		if err := ing.db.wal.sync(); err != nil {
+			return fmt.Errorf("failed to sync WAL: %w", err)
+		}
+	}
+	if size := ing.db.headBlock.add(rec); size >= ing.opts.BatchSize {
+		return ing.Flush()
+	}
+	return nil
+}
+
+// Flush writes every record currently sitting in the head block to Badger,
+// using opts.NumWorkers parallel WriteBatch workers. It does not truncate
+// the WAL - that is the job of DB.Compact, once the caller considers the
+// ingested data durable.
+func (ing *Ingestor) Flush() error {
+	return ing.db.flushHeadBlock(ing.opts.NumWorkers)
+}
+
+// Close flushes any remaining head-block records. The underlying WAL and
+// Badger handles belong to the DB, not the Ingestor, so Close does not
+// close the DB itself.
+func (ing *Ingestor) Close() error {
+	return ing.Flush()
+}
+
+// flushHeadBlock drains the DB's head block and writes it to Badger using
+// numWorkers parallel WriteBatches, then rebuilds the bitmap index (see
+// storeBitmapIndexTx) for every head lemma touched by a pair record in
+// this flush.
+func (db *DB) flushHeadBlock(numWorkers int) error {
+	records := db.headBlock.drain()
+	if len(records) == 0 {
+		return nil
+	}
+	if numWorkers <= 0 {
+		numWorkers = defaultNumWorkers
+	}
+	if numWorkers > len(records) {
+		numWorkers = len(records)
+	}
+
+	chunkSize := (len(records) + numWorkers - 1) / numWorkers
+	var wg sync.WaitGroup
+	errs := make([]error, numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		start := w * chunkSize
+		if start >= len(records) {
+			break
+		}
+		end := start + chunkSize
+		if end > len(records) {
+			end = len(records)
+		}
+		wg.Add(1)
+		go func(w int, chunk []walRecord) {
+			defer wg.Done()
+			errs[w] = db.writeRecordBatch(chunk)
+		}(w, records[start:end])
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("failed to flush head block: %w", err)
+		}
+	}
+
+	if err := db.rebuildBitmapIndexes(records); err != nil {
+		return err
+	}
+	db.cache.invalidateAll()
+	return nil
+}
+
+// writeRecordBatch applies a slice of WAL records to Badger via a single
+// WriteBatch. Pair records are not written here - they only ever live in
+// the bitmap index and frequency vector chunks built by
+// rebuildBitmapIndexes, which is what calculateMeasuresCore reads from.
+func (db *DB) writeRecordBatch(records []walRecord) error {
+	wb := db.bdb.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, rec := range records {
+		var err error
+		switch rec.recType {
+		case walRecordLemma:
+			// Keep the DB-wide high-water mark above every stored tokenID,
+			// including ones assigned by a plain tokenIDSequence.
+			for hwm := db.tokenIDHighWaterMark.Load(); rec.tokenID > hwm; hwm = db.tokenIDHighWaterMark.Load() {
+				if db.tokenIDHighWaterMark.CompareAndSwap(hwm, rec.tokenID) {
+					break
+				}
+			}
+			if err = wb.Set(encodeLemmaKey(rec.lemma), tokenIDToValue(rec.tokenID)); err == nil {
+				err = wb.Set(tokenIDToRIKey(rec.tokenID), []byte(rec.lemma))
+			}
+		case walRecordSingle:
+			err = wb.Set(tokenIDToKey(rec.tokenID), encodeFrequency(rec.freq))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// rebuildBitmapIndexes merges the pair records in this flush into the
+// existing bitmap index (if any) for each head lemma they touch.
+func (db *DB) rebuildBitmapIndexes(records []walRecord) error {
+	newStatsByHead := make(map[uint32]map[uint32]uint32)
+	for _, rec := range records {
+		if rec.recType != walRecordPair {
+			continue
+		}
+		head, ok := newStatsByHead[rec.tokenID]
+		if !ok {
+			head = make(map[uint32]uint32)
+			newStatsByHead[rec.tokenID] = head
+		}
+		head[rec.tokenID2] = rec.freq
+	}
+	if len(newStatsByHead) == 0 {
+		return nil
+	}
+
+	return db.bdb.Update(func(txn *badger.Txn) error {
+		for headID, newStats := range newStatsByHead {
+			merged, err := db.loadCollocatesTxn(txn, headID)
+			if err != nil && err != badger.ErrKeyNotFound {
+				return fmt.Errorf("failed to load existing collocates for head %d: %w", headID, err)
+			}
+			if merged == nil {
+				merged = make(map[uint32]uint32)
+			}
+			for collocateID, freq := range newStats {
+				merged[collocateID] = freq
+			}
+			if err := db.storeBitmapIndexTx(txn, headID, merged); err != nil {
+				return fmt.Errorf("failed to rebuild bitmap index for head %d: %w", headID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Compact flushes any buffered ingestion state to Badger and truncates the
+// WAL, since everything it describes is now safely persisted.
+func (db *DB) Compact() error {
+	if err := db.flushHeadBlock(defaultNumWorkers); err != nil {
+		return err
+	}
+	return db.wal.truncate()
+}
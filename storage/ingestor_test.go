@@ -0,0 +1,118 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import "testing"
+
+func ingestLemma(t *testing.T, db *DB, lemma string, freq uint32) {
+	t.Helper()
+	ing := db.NewIngestor(DefaultIngestorOpts())
+	if err := ing.AddLemma(lemma); err != nil {
+		t.Fatalf("AddLemma(%q) failed: %v", lemma, err)
+	}
+	if err := ing.AddSingle(lemma, freq); err != nil {
+		t.Fatalf("AddSingle(%q) failed: %v", lemma, err)
+	}
+	if err := ing.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+// TestNewIngestorDoesNotReuseTokenIDsAcrossSessions exercises two separate
+// NewIngestor sessions against the same DB (with a reopen between them, as
+// would happen after a restart) and asserts the second session's lemmas
+// get fresh tokenIDs rather than colliding with the first's.
+func TestNewIngestorDoesNotReuseTokenIDsAcrossSessions(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := OpenDB(dir)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	ingestLemma(t, db, "cat_NN", 10)
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	db, err = OpenDB(dir)
+	if err != nil {
+		t.Fatalf("reopen OpenDB failed: %v", err)
+	}
+	defer db.Close()
+	ingestLemma(t, db, "mouse_NN", 4)
+
+	catID, err := db.GetLemmaID("cat_NN")
+	if err != nil {
+		t.Fatalf("GetLemmaID(cat_NN) failed: %v", err)
+	}
+	mouseID, err := db.GetLemmaID("mouse_NN")
+	if err != nil {
+		t.Fatalf("GetLemmaID(mouse_NN) failed: %v", err)
+	}
+	if catID == mouseID {
+		t.Fatalf("cat_NN and mouse_NN were both assigned tokenID %d", catID)
+	}
+
+	catFreq, err := db.getSingleTokenFreq(catID)
+	if err != nil {
+		t.Fatalf("getSingleTokenFreq(cat) failed: %v", err)
+	}
+	if catFreq != 10 {
+		t.Errorf("cat_NN frequency = %d, want 10 (clobbered by the second session?)", catFreq)
+	}
+	mouseFreq, err := db.getSingleTokenFreq(mouseID)
+	if err != nil {
+		t.Fatalf("getSingleTokenFreq(mouse) failed: %v", err)
+	}
+	if mouseFreq != 4 {
+		t.Errorf("mouse_NN frequency = %d, want 4", mouseFreq)
+	}
+
+	catLemma, err := db.GetLemmaByID(catID)
+	if err != nil {
+		t.Fatalf("GetLemmaByID(cat) failed: %v", err)
+	}
+	if catLemma != "cat_NN" {
+		t.Errorf("reverse lookup for tokenID %d = %q, want \"cat_NN\" (overwritten by mouse_NN?)", catID, catLemma)
+	}
+}
+
+// TestNewIngestorDoesNotReuseTokenIDsWithinSameProcess is like
+// TestNewIngestorDoesNotReuseTokenIDsAcrossSessions but without a reopen
+// between sessions, i.e. just two ordinary back-to-back NewIngestor calls.
+func TestNewIngestorDoesNotReuseTokenIDsWithinSameProcess(t *testing.T) {
+	db, err := OpenDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	ingestLemma(t, db, "cat_NN", 10)
+	ingestLemma(t, db, "mouse_NN", 4)
+
+	catID, err := db.GetLemmaID("cat_NN")
+	if err != nil {
+		t.Fatalf("GetLemmaID(cat_NN) failed: %v", err)
+	}
+	mouseID, err := db.GetLemmaID("mouse_NN")
+	if err != nil {
+		t.Fatalf("GetLemmaID(mouse_NN) failed: %v", err)
+	}
+	if catID == mouseID {
+		t.Fatalf("cat_NN and mouse_NN were both assigned tokenID %d", catID)
+	}
+}
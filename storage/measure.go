@@ -0,0 +1,167 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"math"
+	"sync"
+)
+
+// MeasureContext carries the raw quantities a Measure needs to score a
+// single (target, collocate) pair.
+type MeasureContext struct {
+	Fx         float64 // frequency of the target lemma
+	Fy         float64 // frequency of the collocate lemma
+	Fxy        float64 // joint (pair) frequency
+	CorpusSize float64
+	WindowSize float64
+}
+
+// Measure computes a single association score from a MeasureContext.
+// Built-in measures are registered by init(); callers may add their own
+// via RegisterMeasure.
+type Measure interface {
+	// Name identifies the measure for registration, lookup, the
+	// -sort-by flag and the key of Collocation.Scores.
+	Name() string
+	// Compute returns the measure's score for ctx.
+	Compute(ctx MeasureContext) float64
+	// NeedsCorpusSize reports whether ctx.CorpusSize must carry a real
+	// corpus size for Compute to produce a meaningful score.
+	NeedsCorpusSize() bool
+}
+
+var (
+	measureRegistryMu sync.RWMutex
+	measureRegistry   = make(map[string]Measure)
+)
+
+// RegisterMeasure adds m to the set of measures known by name, e.g. to
+// the -sort-by CLI flag and storage.LookupMeasure. Registering a measure
+// under a name that is already taken replaces the previous one.
+func RegisterMeasure(m Measure) {
+	measureRegistryMu.Lock()
+	defer measureRegistryMu.Unlock()
+	measureRegistry[m.Name()] = m
+}
+
+// LookupMeasure returns the measure registered under name, if any.
+func LookupMeasure(name string) (Measure, bool) {
+	measureRegistryMu.RLock()
+	defer measureRegistryMu.RUnlock()
+	m, ok := measureRegistry[name]
+	return m, ok
+}
+
+func init() {
+	RegisterMeasure(miMeasure{})
+	RegisterMeasure(mi3Measure{})
+	RegisterMeasure(logLikelihoodMeasure{})
+	RegisterMeasure(diceMeasure{})
+	RegisterMeasure(minSensitivityMeasure{})
+	RegisterMeasure(logDiceMeasure{})
+	RegisterMeasure(tScoreMeasure{})
+}
+
+// miMeasure is the pointwise mutual information measure.
+type miMeasure struct{}
+
+func (miMeasure) Name() string          { return "mi" }
+func (miMeasure) NeedsCorpusSize() bool { return true }
+func (miMeasure) Compute(ctx MeasureContext) float64 {
+	expected := ctx.Fx * ctx.Fy / ctx.CorpusSize
+	return math.Log2(ctx.Fxy / expected)
+}
+
+// mi3Measure is MI^3, which favors high-frequency collocations more than
+// plain MI by cubing the observed joint frequency.
+type mi3Measure struct{}
+
+func (mi3Measure) Name() string          { return "mi3" }
+func (mi3Measure) NeedsCorpusSize() bool { return true }
+func (mi3Measure) Compute(ctx MeasureContext) float64 {
+	expected := ctx.Fx * ctx.Fy / ctx.CorpusSize
+	return math.Log2(math.Pow(ctx.Fxy, 3) / expected)
+}
+
+// logLikelihoodMeasure is Dunning's log-likelihood ratio (G2) over the
+// 2x2 contingency table implied by Fx, Fy, Fxy and CorpusSize.
+type logLikelihoodMeasure struct{}
+
+func (logLikelihoodMeasure) Name() string          { return "logl" }
+func (logLikelihoodMeasure) NeedsCorpusSize() bool { return true }
+func (logLikelihoodMeasure) Compute(ctx MeasureContext) float64 {
+	n := ctx.CorpusSize
+	a := ctx.Fxy
+	b := ctx.Fx - ctx.Fxy
+	c := ctx.Fy - ctx.Fxy
+	d := n - ctx.Fx - ctx.Fy + ctx.Fxy
+
+	expected := [4]float64{
+		ctx.Fx * ctx.Fy / n,
+		ctx.Fx * (n - ctx.Fy) / n,
+		(n - ctx.Fx) * ctx.Fy / n,
+		(n - ctx.Fx) * (n - ctx.Fy) / n,
+	}
+	observed := [4]float64{a, b, c, d}
+
+	var g2 float64
+	for i, obs := range observed {
+		if obs <= 0 || expected[i] <= 0 {
+			continue
+		}
+		g2 += obs * math.Log(obs/expected[i])
+	}
+	return 2 * g2
+}
+
+// diceMeasure is the Dice coefficient.
+type diceMeasure struct{}
+
+func (diceMeasure) Name() string          { return "dice" }
+func (diceMeasure) NeedsCorpusSize() bool { return false }
+func (diceMeasure) Compute(ctx MeasureContext) float64 {
+	return 2 * ctx.Fxy / (ctx.Fx + ctx.Fy)
+}
+
+// minSensitivityMeasure is the minimum sensitivity measure, i.e. the
+// smaller of the two conditional probabilities P(y|x) and P(x|y).
+type minSensitivityMeasure struct{}
+
+func (minSensitivityMeasure) Name() string          { return "minsens" }
+func (minSensitivityMeasure) NeedsCorpusSize() bool { return false }
+func (minSensitivityMeasure) Compute(ctx MeasureContext) float64 {
+	return math.Min(ctx.Fxy/ctx.Fx, ctx.Fxy/ctx.Fy)
+}
+
+// logDiceMeasure is the logDice measure used by Sketch Engine.
+type logDiceMeasure struct{}
+
+func (logDiceMeasure) Name() string          { return "ldice" }
+func (logDiceMeasure) NeedsCorpusSize() bool { return false }
+func (logDiceMeasure) Compute(ctx MeasureContext) float64 {
+	return 14.0 + math.Log2(2*ctx.Fxy/(ctx.Fx+ctx.Fy))
+}
+
+// tScoreMeasure is the classic t-score association measure.
+type tScoreMeasure struct{}
+
+func (tScoreMeasure) Name() string          { return "tscore" }
+func (tScoreMeasure) NeedsCorpusSize() bool { return true }
+func (tScoreMeasure) Compute(ctx MeasureContext) float64 {
+	return (ctx.Fxy - ctx.Fx*ctx.Fy/ctx.CorpusSize) / math.Sqrt(ctx.Fxy)
+}
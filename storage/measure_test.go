@@ -0,0 +1,105 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMeasuresAreRegisteredByName(t *testing.T) {
+	for _, name := range []string{"mi", "mi3", "logl", "dice", "minsens", "ldice", "tscore"} {
+		if _, ok := LookupMeasure(name); !ok {
+			t.Errorf("measure %q is not registered", name)
+		}
+	}
+}
+
+func TestMeasureCompute(t *testing.T) {
+	ctx := MeasureContext{Fx: 100, Fy: 50, Fxy: 20, CorpusSize: 1000000}
+
+	tests := []struct {
+		name    string
+		want    float64
+		needsCS bool
+	}{
+		{"mi", math.Log2(ctx.Fxy / (ctx.Fx * ctx.Fy / ctx.CorpusSize)), true},
+		{"mi3", math.Log2(math.Pow(ctx.Fxy, 3) / (ctx.Fx * ctx.Fy / ctx.CorpusSize)), true},
+		{"dice", 2 * ctx.Fxy / (ctx.Fx + ctx.Fy), false},
+		{"minsens", math.Min(ctx.Fxy/ctx.Fx, ctx.Fxy/ctx.Fy), false},
+		{"ldice", 14.0 + math.Log2(2*ctx.Fxy/(ctx.Fx+ctx.Fy)), false},
+		{"tscore", (ctx.Fxy - ctx.Fx*ctx.Fy/ctx.CorpusSize) / math.Sqrt(ctx.Fxy), true},
+	}
+	for _, tt := range tests {
+		m, ok := LookupMeasure(tt.name)
+		if !ok {
+			t.Fatalf("measure %q not registered", tt.name)
+		}
+		if m.NeedsCorpusSize() != tt.needsCS {
+			t.Errorf("%s.NeedsCorpusSize() = %v, want %v", tt.name, m.NeedsCorpusSize(), tt.needsCS)
+		}
+		if got := m.Compute(ctx); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s.Compute(%+v) = %v, want %v", tt.name, ctx, got, tt.want)
+		}
+	}
+}
+
+func TestLogLikelihoodMeasure(t *testing.T) {
+	m, ok := LookupMeasure("logl")
+	if !ok {
+		t.Fatal("measure \"logl\" not registered")
+	}
+	ctx := MeasureContext{Fx: 100, Fy: 50, Fxy: 20, CorpusSize: 1000000}
+	got := m.Compute(ctx)
+	if got <= 0 {
+		t.Errorf("log-likelihood for an over-represented pair should be positive, got %v", got)
+	}
+
+	// A pair with the expected (chance-level) joint frequency should
+	// score close to zero.
+	expectedFxy := ctx.Fx * ctx.Fy / ctx.CorpusSize
+	chanceCtx := MeasureContext{Fx: ctx.Fx, Fy: ctx.Fy, Fxy: expectedFxy, CorpusSize: ctx.CorpusSize}
+	if got := m.Compute(chanceCtx); math.Abs(got) > 1e-6 {
+		t.Errorf("log-likelihood at chance-level frequency = %v, want ~0", got)
+	}
+}
+
+func TestRegisterMeasureOverridesExisting(t *testing.T) {
+	orig, ok := LookupMeasure("dice")
+	if !ok {
+		t.Fatal("measure \"dice\" not registered")
+	}
+	defer RegisterMeasure(orig)
+
+	RegisterMeasure(constMeasure{name: "dice", value: 42})
+	m, ok := LookupMeasure("dice")
+	if !ok {
+		t.Fatal("measure \"dice\" missing after RegisterMeasure")
+	}
+	if got := m.Compute(MeasureContext{}); got != 42 {
+		t.Errorf("Compute() = %v, want 42 (RegisterMeasure should replace the previous \"dice\")", got)
+	}
+}
+
+type constMeasure struct {
+	name  string
+	value float64
+}
+
+func (c constMeasure) Name() string                       { return c.name }
+func (c constMeasure) NeedsCorpusSize() bool              { return false }
+func (c constMeasure) Compute(ctx MeasureContext) float64 { return c.value }
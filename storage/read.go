@@ -18,29 +18,37 @@ package storage
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"math"
 	"sort"
 	"strings"
 
+	"github.com/RoaringBitmap/roaring"
 	"github.com/dgraph-io/badger/v4"
 )
 
-const (
-	sortByLogDice SortingMeasure = "ldice"
-	sortByTScore  SortingMeasure = "tscore"
-)
-
+// SortingMeasure names a registered Measure (see RegisterMeasure) by which
+// CalculateMeasures results should be sorted.
 type SortingMeasure string
 
+// Validate reports whether m names a measure registered via
+// RegisterMeasure.
 func (m SortingMeasure) Validate() bool {
-	return m == sortByLogDice || m == sortByTScore
+	_, ok := LookupMeasure(string(m))
+	return ok
 }
 
 // GetLemmaID returns numeric representation of a provided
 // lemma. In case the lemma is not found, zero is returned
 // (i.e. no error).
 func (db *DB) GetLemmaID(lemma string) (uint32, error) {
+	cacheKey := lemmaIDCacheKey(lemma)
+	if v, ok := db.cache.get(cacheKey); ok {
+		db.cacheHits.Add(1)
+		return v.(uint32), nil
+	}
+	db.cacheMisses.Add(1)
+
 	var tokenID uint32
 	err := db.bdb.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(encodeLemmaKey(lemma))
@@ -56,6 +64,9 @@ func (db *DB) GetLemmaID(lemma string) (uint32, error) {
 		tokenID = binary.LittleEndian.Uint32(tokenIDBytes)
 		return nil
 	})
+	if err == nil {
+		db.cache.set(cacheKey, tokenID, 1)
+	}
 	return tokenID, err
 }
 
@@ -101,7 +112,7 @@ func (db *DB) GetLemmaIDsByPrefix(lemmaPrefix string) ([]lemmaMatch, error) {
 }
 
 func (db *DB) getLemmaByIDTxn(txn *badger.Txn, tokenID uint32) (string, error) {
-	item, err := txn.Get(encodeIDToLemmaKey(tokenID))
+	item, err := txn.Get(tokenIDToRIKey(tokenID))
 	if err != nil {
 		return "", err
 	}
@@ -115,9 +126,16 @@ func (db *DB) getLemmaByIDTxn(txn *badger.Txn, tokenID uint32) (string, error) {
 }
 
 func (db *DB) GetLemmaByID(tokenID uint32) (string, error) {
+	cacheKey := lemmaByIDCacheKey(tokenID)
+	if v, ok := db.cache.get(cacheKey); ok {
+		db.cacheHits.Add(1)
+		return v.(string), nil
+	}
+	db.cacheMisses.Add(1)
+
 	var lemma string
 	err := db.bdb.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(encodeIDToLemmaKey(tokenID))
+		item, err := txn.Get(tokenIDToRIKey(tokenID))
 		if err != nil {
 			return err
 		}
@@ -130,11 +148,14 @@ func (db *DB) GetLemmaByID(tokenID uint32) (string, error) {
 		lemma = strings.TrimSpace(string(lemmaBytes))
 		return nil
 	})
+	if err == nil {
+		db.cache.set(cacheKey, lemma, int64(len(lemma)))
+	}
 	return lemma, err
 }
 
 func getSingleTokenFreqCopy(txn *badger.Txn, tokenID uint32) (uint32, error) {
-	key := encodeSingleTokenKey(tokenID)
+	key := tokenIDToKey(tokenID)
 
 	item, err := txn.Get(key)
 	if err != nil {
@@ -154,18 +175,26 @@ func getSingleTokenFreqCopy(txn *badger.Txn, tokenID uint32) (uint32, error) {
 }
 
 func (db *DB) getSingleTokenFreq(tokenID uint32) (uint32, error) {
-	var frequency uint32
+	cacheKey := singleFreqCacheKey(tokenID)
+	if v, ok := db.cache.get(cacheKey); ok {
+		db.cacheHits.Add(1)
+		return v.(uint32), nil
+	}
+	db.cacheMisses.Add(1)
 
+	var frequency uint32
 	err := db.bdb.View(func(txn *badger.Txn) error {
 		return db.getSingleTokenFreqTx(txn, tokenID, &frequency)
 	})
-
+	if err == nil {
+		db.cache.set(cacheKey, frequency, 1)
+	}
 	return frequency, err
 }
 
 // Version that works within an existing transaction
 func (db *DB) getSingleTokenFreqTx(txn *badger.Txn, tokenID uint32, frequency *uint32) error {
-	key := encodeSingleTokenKey(tokenID)
+	key := tokenIDToKey(tokenID)
 
 	item, err := txn.Get(key)
 	if err != nil {
@@ -181,7 +210,24 @@ func (db *DB) getSingleTokenFreqTx(txn *badger.Txn, tokenID uint32, frequency *u
 	})
 }
 
-func (db *DB) CalculateMeasures(lemma string, corpusSize int, limit int, sortBy SortingMeasure) ([]Collocation, error) {
+// resolveScoreMeasures returns measures with sortBy's measure appended if
+// it isn't already present, since sortBy must always be scored.
+func resolveScoreMeasures(sortBy SortingMeasure, measures []Measure) []Measure {
+	sortByMeasure, _ := LookupMeasure(string(sortBy))
+	for _, m := range measures {
+		if m.Name() == sortByMeasure.Name() {
+			return measures
+		}
+	}
+	return append(append([]Measure{}, measures...), sortByMeasure)
+}
+
+// CalculateMeasures looks up every collocate of lemma and, for each pair,
+// computes the score of every measure in measures plus (if not already
+// among them) sortBy, storing them by name in Collocation.Scores. This
+// way a caller that wants several measures for the same lemma pays for
+// the Badger lookups once, regardless of how many measures it requests.
+func (db *DB) CalculateMeasures(lemma string, corpusSize int, limit int, sortBy SortingMeasure, measures []Measure) ([]Collocation, error) {
 	if limit < 0 {
 		panic("CalculateMeasures - invalid limit value")
 	}
@@ -191,88 +237,187 @@ func (db *DB) CalculateMeasures(lemma string, corpusSize int, limit int, sortBy
 	if !sortBy.Validate() {
 		panic("CalculateMeasures - invalid sortBy value")
 	}
-	variants, err := db.GetLemmaIDsByPrefix(lemma)
-	if err == badger.ErrKeyNotFound {
-		return []Collocation{}, fmt.Errorf("failed to find matching lemma(s): %w", err)
+
+	scoreMeasures := resolveScoreMeasures(sortBy, measures)
+
+	cacheKey := measuresCacheKey(lemma, corpusSize, limit, sortBy, scoreMeasures)
+	if v, ok := db.cache.get(cacheKey); ok {
+		db.cacheHits.Add(1)
+		return v.([]Collocation), nil
 	}
+	db.cacheMisses.Add(1)
 
 	var results []Collocation
+	err := db.calculateMeasuresCore(lemma, corpusSize, scoreMeasures, func(c Collocation) error {
+		results = append(results, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Scores[string(sortBy)] > results[j].Scores[string(sortBy)]
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	db.cache.set(cacheKey, results, int64(len(results))+1)
+	return results, nil
+}
+
+// errStreamLimitReached is a sentinel used internally by
+// CalculateMeasuresStream to stop calculateMeasuresCore early without
+// surfacing an error to the caller.
+var errStreamLimitReached = errors.New("stream limit reached")
+
+// CalculateMeasuresStream is like CalculateMeasures, but invokes emit for
+// every collocation as soon as it is scored instead of collecting,
+// sorting and returning them all at once. This lets a caller (e.g. the
+// HTTP server's NDJSON mode) start forwarding results to a client before
+// the whole collocate set has been read and scored. Because it forwards
+// results in computation order rather than sorted by sortBy, it does not
+// consult or populate the query cache. limit (if positive) stops
+// emission after that many collocations rather than bounding the amount
+// of work done up front.
+func (db *DB) CalculateMeasuresStream(
+	lemma string,
+	corpusSize int,
+	limit int,
+	sortBy SortingMeasure,
+	measures []Measure,
+	emit func(Collocation) error,
+) error {
+	if limit < 0 {
+		panic("CalculateMeasuresStream - invalid limit value")
+	}
+	if corpusSize < 0 {
+		panic("CalculateMeasuresStream - invalid corpusSize value")
+	}
+	if !sortBy.Validate() {
+		panic("CalculateMeasuresStream - invalid sortBy value")
+	}
+
+	scoreMeasures := resolveScoreMeasures(sortBy, measures)
+
+	count := 0
+	err := db.calculateMeasuresCore(lemma, corpusSize, scoreMeasures, func(c Collocation) error {
+		if err := emit(c); err != nil {
+			return err
+		}
+		count++
+		if limit > 0 && count >= limit {
+			return errStreamLimitReached
+		}
+		return nil
+	})
+	if err != nil && err != errStreamLimitReached {
+		return err
+	}
+	return nil
+}
+
+// calculateMeasuresCore does the actual bitmap-index lookup and scoring
+// for every collocate of lemma, invoking emit for each one as soon as it
+// is computed. An error returned by emit aborts iteration immediately and
+// is propagated to the caller, except for errStreamLimitReached which
+// calculateMeasuresCore itself never returns (callers only need to check
+// for it if their own emit returns it).
+func (db *DB) calculateMeasuresCore(lemma string, corpusSize int, scoreMeasures []Measure, emit func(Collocation) error) error {
+	variants, err := db.GetLemmaIDsByPrefix(lemma)
+	if err == badger.ErrKeyNotFound {
+		return fmt.Errorf("failed to find matching lemma(s): %w", err)
+	}
 
 	for _, lemmaMatch := range variants {
 		// First, get F(x) - frequency of target lemma
 		targetFreq, err := db.getSingleTokenFreq(lemmaMatch.TokenID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get target frequency: %w", err)
+			return fmt.Errorf("failed to get target frequency: %w", err)
 		}
 
+		filter := db.collocateFilterFor(lemmaMatch.TokenID)
+
 		err = db.bdb.View(func(txn *badger.Txn) error {
-			// Create prefix for all pairs starting with target lemma
-			pairPrefix := make([]byte, 5)
-			pairPrefix[0] = PairTokenPrefix
-			binary.LittleEndian.PutUint32(pairPrefix[1:5], lemmaMatch.TokenID)
-
-			opts := badger.DefaultIteratorOptions
-			opts.Prefix = pairPrefix
-			it := txn.NewIterator(opts)
-			defer it.Close()
-
-			for it.Rewind(); it.Valid(); it.Next() {
-				item := it.Item()
-				key := item.Key()
-
-				// Extract second lemma ID from key
-				secondLemmaID := binary.LittleEndian.Uint32(key[5:9])
-
-				// Get F(x,y) - pair frequency
-				var pairFreq uint32
-				var pairDist uint16
-				err := item.Value(func(val []byte) error {
-					pairFreq, pairDist = decodeFrequencyAndDist(val)
-					return nil
-				})
-				if err != nil {
-					// TODO
-					continue
-				}
+			fullBM, err := db.getBitmapIndexTxn(txn, lemmaMatch.TokenID)
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			candidates := fullBM
+			if filter != nil {
+				candidates = roaring.And(fullBM, filter)
+			}
 
-				// Get F(y) - frequency of second lemma
-				secondFreq, err := getSingleTokenFreqCopy(txn, secondLemmaID)
+			// Group candidates by frequency-vector chunk so each chunk is
+			// fetched with a single value read instead of one per pair.
+			type rankedID struct {
+				id   uint32
+				rank uint32
+			}
+			byChunk := make(map[uint32][]rankedID)
+			it := candidates.Iterator()
+			for it.HasNext() {
+				id := it.Next()
+				rank := uint32(fullBM.Rank(id)) - 1
+				chunkID := rank / bitmapChunkSize
+				byChunk[chunkID] = append(byChunk[chunkID], rankedID{id: id, rank: rank})
+			}
+
+			for chunkID, entries := range byChunk {
+				freqs, err := db.getFreqVectorTxn(txn, lemmaMatch.TokenID, chunkID)
 				if err != nil {
-					continue // Skip if we can't find single freq
+					return fmt.Errorf(
+						"failed to load frequency vector chunk %d for head %d: %w",
+						chunkID, lemmaMatch.TokenID, err)
 				}
-				logDice := 14.0 + math.Log2(float64(2*pairFreq)/float64(targetFreq+secondFreq))
-				tscore := (float64(pairFreq) - float64(targetFreq)*float64(secondFreq)/float64(corpusSize)) / math.Sqrt(float64(pairFreq))
-				secondLemma, err := db.getLemmaByIDTxn(txn, secondLemmaID)
-				if err != nil {
-					// TODO
-					continue
+				for _, entry := range entries {
+					offset := entry.rank % bitmapChunkSize
+					pairFreq := freqs[offset]
+
+					secondFreq, err := getSingleTokenFreqCopy(txn, entry.id)
+					if err != nil {
+						continue // Skip if we can't find single freq
+					}
+					secondLemma, err := db.getLemmaByIDTxn(txn, entry.id)
+					if err != nil {
+						// TODO
+						continue
+					}
+
+					ctx := MeasureContext{
+						Fx:         float64(targetFreq),
+						Fy:         float64(secondFreq),
+						Fxy:        float64(pairFreq),
+						CorpusSize: float64(corpusSize),
+					}
+					scores := make(map[string]float64, len(scoreMeasures))
+					for _, m := range scoreMeasures {
+						scores[m.Name()] = m.Compute(ctx)
+					}
+
+					if err := emit(Collocation{
+						RawLemma:     lemmaMatch.Value,
+						RawCollocate: secondLemma,
+						Scores:       scores,
+					}); err != nil {
+						return err
+					}
 				}
-
-				results = append(results, Collocation{
-					RawLemma:     lemmaMatch.Value,
-					RawCollocate: secondLemma,
-					LogDice:      logDice,
-					TScore:       tscore,
-					MutualDist:   mutualPositionToInt(pairDist),
-				})
 			}
 			return nil
 		})
+		if err == errStreamLimitReached {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to calculate measures: %w", err)
+		}
 	}
-	switch sortBy {
-	case sortByTScore:
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].TScore > results[j].TScore
-		})
-	case sortByLogDice:
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].LogDice > results[j].LogDice
-		})
-	}
-	if len(results) > limit {
-		results = results[:limit]
-	}
-	return results, err
+	return nil
 }
 
 func splitByLastUnderscore(s string) (string, string) {
@@ -288,9 +433,8 @@ func splitByLastUnderscore(s string) (string, string) {
 type Collocation struct {
 	RawLemma     string
 	RawCollocate string
-	LogDice      float64
-	TScore       float64
-	MutualDist   int
+	// Scores holds one entry per requested Measure, keyed by Measure.Name.
+	Scores map[string]float64
 }
 
 func (res *Collocation) LemmaAndFn() (string, string) {
@@ -301,25 +445,102 @@ func (res *Collocation) CollocateAndFn() (string, string) {
 	return splitByLastUnderscore(res.RawCollocate)
 }
 
+// TabString renders the collocation as a tab-separated line: lemma, PoS,
+// collocate, PoS, followed by each of ldr.Scores in alphabetical order of
+// measure name (so the column order is stable regardless of map
+// iteration).
 func (ldr Collocation) TabString() string {
 	lemma1, deprel1 := splitByLastUnderscore(ldr.RawLemma)
 	lemma2, deprel2 := splitByLastUnderscore(ldr.RawCollocate)
-	return fmt.Sprintf("%s\t(%s)\t%s\t(%s)\t%01.2f\t%01.2f", lemma1, deprel1, lemma2, deprel2, ldr.LogDice, ldr.TScore)
+
+	names := make([]string, 0, len(ldr.Scores))
+	for name := range ldr.Scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var scoreCols strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&scoreCols, "\t%01.2f", ldr.Scores[name])
+	}
+	return fmt.Sprintf("%s\t(%s)\t%s\t(%s)%s", lemma1, deprel1, lemma2, deprel2, scoreCols.String())
 }
 
 // --------
 
+// OpenDB opens the collocations database at path with caching disabled.
+// Use OpenDBWithOptions to enable the in-process hot-query cache.
 func OpenDB(path string) (*DB, error) {
+	return OpenDBWithOptions(path, DBOptions{})
+}
+
+// OpenDBWithOptions opens the collocations database at path, applying
+// opts (e.g. an in-process Ristretto cache for hot lemma/collocation
+// queries).
+func OpenDBWithOptions(path string, dbOpts DBOptions) (*DB, error) {
 	opts := badger.DefaultOptions(path).
 		WithValueLogFileSize(256 << 20). // 256MB value log files
 		WithNumMemtables(8).             // More memtables for writes
 		WithNumLevelZeroTables(8)
 
-	ans := &DB{}
+	ans := &DB{
+		dir:              path,
+		headBlock:        &headBlock{},
+		collocateFilters: make(map[uint32]*roaring.Bitmap),
+	}
 	db, err := badger.Open(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open collocations database: %w", err)
 	}
 	ans.bdb = db
+
+	// Replay any WAL records left behind by a crash during the previous
+	// ingestion before this DB starts serving reads.
+	replayed, err := replayWAL(path)
+	if err != nil {
+		ans.bdb.Close()
+		return nil, fmt.Errorf("failed to replay ingestion WAL: %w", err)
+	}
+	var lastSeq uint64
+	if len(replayed) > 0 {
+		ans.headBlock.records = replayed
+		if err := ans.flushHeadBlock(defaultNumWorkers); err != nil {
+			ans.bdb.Close()
+			return nil, fmt.Errorf("failed to replay ingestion WAL: %w", err)
+		}
+		lastSeq = replayed[len(replayed)-1].seq
+	}
+
+	wal, err := openWALWriter(path, lastSeq)
+	if err != nil {
+		ans.bdb.Close()
+		return nil, err
+	}
+	ans.wal = wal
+
+	// The replayed records are now durably flushed to Badger, so the WAL
+	// that described them would otherwise just be replayed (and grown)
+	// again on every subsequent restart.
+	if len(replayed) > 0 {
+		if err := wal.truncate(); err != nil {
+			ans.bdb.Close()
+			return nil, fmt.Errorf("failed to truncate replayed WAL: %w", err)
+		}
+	}
+
+	maxTokenID, err := scanMaxTokenID(ans.bdb)
+	if err != nil {
+		ans.bdb.Close()
+		return nil, fmt.Errorf("failed to determine highest assigned tokenID: %w", err)
+	}
+	ans.tokenIDHighWaterMark.Store(maxTokenID)
+
+	cache, err := newQueryCache(dbOpts)
+	if err != nil {
+		ans.bdb.Close()
+		return nil, err
+	}
+	ans.cache = cache
+
 	return ans, nil
 }
@@ -0,0 +1,239 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// walFileName is the name of the ingestion write-ahead log, kept directly
+// under the DB directory next to the Badger data files.
+const walFileName = "ingest.wal"
+
+// walRecordHeaderSize is the size, in bytes, of a WAL record's fixed header
+// (type + seq + payload length), i.e. everything before the payload.
+const walRecordHeaderSize = 1 + 8 + 4
+
+type walRecordType byte
+
+const (
+	walRecordLemma  walRecordType = 1
+	walRecordSingle walRecordType = 2
+	walRecordPair   walRecordType = 3
+)
+
+// walRecord is a single ingestion event as it is written to the WAL.
+// Lemma records carry the resolved tokenID plus the original lemma text
+// (needed to rebuild the lemma<->tokenID indexes); single and pair records
+// only ever reference already-resolved tokenIDs.
+type walRecord struct {
+	seq      uint64
+	recType  walRecordType
+	tokenID  uint32
+	tokenID2 uint32 // only set for walRecordPair
+	freq     uint32 // only set for walRecordSingle and walRecordPair
+	lemma    string // only set for walRecordLemma
+}
+
+// encodeWALRecord serializes rec as
+// [type(1)][seq(8)][payloadLen(4)][payload][crc32(4)].
+func encodeWALRecord(rec walRecord) []byte {
+	var payload []byte
+	switch rec.recType {
+	case walRecordLemma:
+		lemmaBytes := []byte(rec.lemma)
+		payload = make([]byte, 4+2+len(lemmaBytes))
+		binary.LittleEndian.PutUint32(payload[0:4], rec.tokenID)
+		binary.LittleEndian.PutUint16(payload[4:6], uint16(len(lemmaBytes)))
+		copy(payload[6:], lemmaBytes)
+	case walRecordSingle:
+		payload = make([]byte, 8)
+		binary.LittleEndian.PutUint32(payload[0:4], rec.tokenID)
+		binary.LittleEndian.PutUint32(payload[4:8], rec.freq)
+	case walRecordPair:
+		payload = make([]byte, 12)
+		binary.LittleEndian.PutUint32(payload[0:4], rec.tokenID)
+		binary.LittleEndian.PutUint32(payload[4:8], rec.tokenID2)
+		binary.LittleEndian.PutUint32(payload[8:12], rec.freq)
+	default:
+		panic(fmt.Sprintf("encodeWALRecord - unknown record type %d", rec.recType))
+	}
+
+	buf := make([]byte, walRecordHeaderSize+len(payload)+4)
+	buf[0] = byte(rec.recType)
+	binary.LittleEndian.PutUint64(buf[1:9], rec.seq)
+	binary.LittleEndian.PutUint32(buf[9:13], uint32(len(payload)))
+	copy(buf[walRecordHeaderSize:], payload)
+	crc := crc32.ChecksumIEEE(buf[:walRecordHeaderSize+len(payload)])
+	binary.LittleEndian.PutUint32(buf[len(buf)-4:], crc)
+	return buf
+}
+
+// decodeWALRecord reads and validates a single record from r. It returns
+// io.EOF (wrapped or bare, as returned by r) once no further bytes are
+// available, and a non-nil error for any record that fails its checksum
+// or is otherwise malformed - callers treat such an error as "end of the
+// valid WAL", since it is what a crash mid-append leaves behind.
+func decodeWALRecord(r io.Reader) (walRecord, error) {
+	header := make([]byte, walRecordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return walRecord{}, err
+	}
+	recType := walRecordType(header[0])
+	seq := binary.LittleEndian.Uint64(header[1:9])
+	payloadLen := binary.LittleEndian.Uint32(header[9:13])
+
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return walRecord{}, err
+	}
+
+	crcBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, crcBuf); err != nil {
+		return walRecord{}, err
+	}
+	wantCRC := binary.LittleEndian.Uint32(crcBuf)
+	gotCRC := crc32.ChecksumIEEE(append(append([]byte{}, header...), payload...))
+	if gotCRC != wantCRC {
+		return walRecord{}, fmt.Errorf("WAL record %d failed checksum validation", seq)
+	}
+
+	rec := walRecord{seq: seq, recType: recType}
+	switch recType {
+	case walRecordLemma:
+		if len(payload) < 6 {
+			return walRecord{}, fmt.Errorf("WAL record %d has truncated lemma payload", seq)
+		}
+		rec.tokenID = binary.LittleEndian.Uint32(payload[0:4])
+		lemmaLen := binary.LittleEndian.Uint16(payload[4:6])
+		if len(payload) < 6+int(lemmaLen) {
+			return walRecord{}, fmt.Errorf("WAL record %d has truncated lemma payload", seq)
+		}
+		rec.lemma = string(payload[6 : 6+int(lemmaLen)])
+	case walRecordSingle:
+		if len(payload) != 8 {
+			return walRecord{}, fmt.Errorf("WAL record %d has invalid single-freq payload length: %d", seq, len(payload))
+		}
+		rec.tokenID = binary.LittleEndian.Uint32(payload[0:4])
+		rec.freq = binary.LittleEndian.Uint32(payload[4:8])
+	case walRecordPair:
+		if len(payload) != 12 {
+			return walRecord{}, fmt.Errorf("WAL record %d has invalid pair-freq payload length: %d", seq, len(payload))
+		}
+		rec.tokenID = binary.LittleEndian.Uint32(payload[0:4])
+		rec.tokenID2 = binary.LittleEndian.Uint32(payload[4:8])
+		rec.freq = binary.LittleEndian.Uint32(payload[8:12])
+	default:
+		return walRecord{}, fmt.Errorf("WAL record %d has unknown record type %d", seq, recType)
+	}
+	return rec, nil
+}
+
+// walWriter is an append-only, crash-recoverable log of ingestion records.
+type walWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	seq uint64
+}
+
+func walPath(dir string) string {
+	return filepath.Join(dir, walFileName)
+}
+
+// openWALWriter opens (creating if necessary) the WAL file for dir,
+// positioned for appending. seq should be initialized to the highest
+// sequence number found during replay (zero for a fresh WAL).
+func openWALWriter(dir string, seq uint64) (*walWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+	f, err := os.OpenFile(walPath(dir), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL file: %w", err)
+	}
+	return &walWriter{f: f, seq: seq}, nil
+}
+
+// append assigns the next sequence number to rec and writes it to the WAL.
+func (w *walWriter) append(rec walRecord) (walRecord, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	rec.seq = w.seq
+	if _, err := w.f.Write(encodeWALRecord(rec)); err != nil {
+		return walRecord{}, fmt.Errorf("failed to append WAL record: %w", err)
+	}
+	return rec, nil
+}
+
+func (w *walWriter) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Sync()
+}
+
+// truncate discards all WAL content, e.g. once the caller has confirmed
+// everything it describes is safely persisted elsewhere (see DB.Compact).
+func (w *walWriter) truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate WAL: %w", err)
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind WAL: %w", err)
+	}
+	w.seq = 0
+	return nil
+}
+
+func (w *walWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// replayWAL reads every valid record from the WAL file in dir, in order.
+// A missing WAL file is not an error (fresh DB directory); a short or
+// corrupt trailing record (the hallmark of a crash mid-append) simply
+// ends replay at the last good record instead of failing it.
+func replayWAL(dir string) ([]walRecord, error) {
+	f, err := os.Open(walPath(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL for replay: %w", err)
+	}
+	defer f.Close()
+
+	var records []walRecord
+	for {
+		rec, err := decodeWALRecord(f)
+		if err != nil {
+			break
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
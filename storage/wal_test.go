@@ -0,0 +1,116 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestWALRecordRoundtrip(t *testing.T) {
+	cases := []walRecord{
+		{seq: 1, recType: walRecordLemma, tokenID: 42, lemma: "dog_NN"},
+		{seq: 2, recType: walRecordSingle, tokenID: 42, freq: 7},
+		{seq: 3, recType: walRecordPair, tokenID: 42, tokenID2: 43, freq: 3},
+	}
+	for _, want := range cases {
+		encoded := encodeWALRecord(want)
+		got, err := decodeWALRecord(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("decodeWALRecord failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("decodeWALRecord = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReplayWALStopsAtTruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := openWALWriter(dir, 0)
+	if err != nil {
+		t.Fatalf("openWALWriter failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := wal.append(walRecord{recType: walRecordSingle, tokenID: uint32(i), freq: 1}); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if err := wal.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	// Simulate a crash mid-append by chopping off the last few bytes of
+	// the file (the third record's trailing CRC).
+	path := walPath(dir)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if err := os.Truncate(path, info.Size()-2); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+
+	records, err := replayWAL(dir)
+	if err != nil {
+		t.Fatalf("replayWAL failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("replayWAL returned %d records, want 2 (the corrupt trailing one should be dropped)", len(records))
+	}
+}
+
+func TestOpenDBTruncatesWALAfterReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	wal, err := openWALWriter(dir, 0)
+	if err != nil {
+		t.Fatalf("openWALWriter failed: %v", err)
+	}
+	if _, err := wal.append(walRecord{recType: walRecordLemma, tokenID: 1, lemma: "dog_NN"}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if _, err := wal.append(walRecord{recType: walRecordSingle, tokenID: 1, freq: 5}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := wal.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	db, err := OpenDB(dir)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	info, err := os.Stat(walPath(dir))
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("WAL size after replay = %d bytes, want 0 (replayed records should be truncated once flushed)", info.Size())
+	}
+
+	freq, err := db.getSingleTokenFreq(1)
+	if err != nil {
+		t.Fatalf("getSingleTokenFreq failed: %v", err)
+	}
+	if freq != 5 {
+		t.Errorf("getSingleTokenFreq = %d, want 5 (replayed record should have been flushed)", freq)
+	}
+}
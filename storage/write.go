@@ -18,22 +18,38 @@ package storage
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/dgraph-io/badger/v4"
 )
 
+// tokenIDSequence hands out tokenIDs for lemmas within an ingestion
+// session. Plain sequences assigned by NewTokenIDSequence start fresh at
+// 1 each time, so a caller reusing one across several ingestion passes is
+// responsible for not colliding with tokenIDs already committed to the
+// DB. Sequences returned by DB.NewIngestor instead draw from the DB's
+// shared tokenIDHighWaterMark (see newDBTokenIDSequence), so repeated
+// NewIngestor sessions never reassign an ID already owned by another
+// lemma.
 type tokenIDSequence struct {
-	value uint32
-	cache map[string]uint32
+	value   uint32
+	counter *atomic.Uint32
+	cache   map[string]uint32
 }
 
 func (tseq *tokenIDSequence) next(lemma string) uint32 {
-	tseq.value++
-	if tseq.value == 0 {
+	var id uint32
+	if tseq.counter != nil {
+		id = tseq.counter.Add(1)
+	} else {
+		tseq.value++
+		id = tseq.value
+	}
+	if id == 0 {
 		panic("tokenIDSequence overflow")
 	}
-	tseq.cache[lemma] = tseq.value
-	return tseq.value
+	tseq.cache[lemma] = id
+	return id
 }
 
 func (tseq *tokenIDSequence) recall(lemma string) uint32 {
@@ -48,16 +64,20 @@ func NewTokenIDSequence() *tokenIDSequence {
 	}
 }
 
+// newDBTokenIDSequence returns a tokenIDSequence that draws new tokenIDs
+// from db's shared, persistently-seeded high-water mark (see
+// scanMaxTokenID) instead of starting over at 1.
+func (db *DB) newDBTokenIDSequence() *tokenIDSequence {
+	return &tokenIDSequence{
+		counter: &db.tokenIDHighWaterMark,
+		cache:   make(map[string]uint32),
+	}
+}
+
 // --------------
 
 func (db *DB) StoreSingleTokenFreqTx(txn *badger.Txn, tokenID uint32, frequency uint32) error {
-	key := encodeSingleTokenKey(tokenID)
-	value := encodeFrequency(frequency)
-	return txn.Set(key, value)
-}
-
-func (db *DB) StorePairTokenFreqTx(txn *badger.Txn, token1ID, token2ID uint32, frequency uint32) error {
-	key := encodePairTokenKey(token1ID, token2ID)
+	key := tokenIDToKey(tokenID)
 	value := encodeFrequency(frequency)
 	return txn.Set(key, value)
 }
@@ -68,44 +88,37 @@ func (db *DB) CreateTransaction() *badger.Txn {
 
 func (db *DB) StoreLemmaTx(txn *badger.Txn, lemma string, tokenID uint32) error {
 	key := encodeLemmaKey(lemma)
-	value := encodeTokenID(tokenID)
+	value := tokenIDToValue(tokenID)
 	if err := txn.Set(key, value); err != nil {
 		return err
 	}
 	// Store tokenID -> lemma mapping (reverse index)
-	idKey := encodeIDToLemmaKey(tokenID)
+	idKey := tokenIDToRIKey(tokenID)
 	return txn.Set(idKey, []byte(lemma))
 }
 
+// StoreData is a thin, backward-compatible wrapper around the
+// WAL-backed ingestion pipeline (see NewIngestor). It logs every lemma,
+// single-token frequency and qualifying pair frequency through an
+// Ingestor bound to tidSeq, then flushes and closes it.
 func (db *DB) StoreData(
 	tidSeq *tokenIDSequence,
 	singleFreqs map[string]int,
 	pairFreqs map[[2]string]int,
 	minPairFreq int) error {
 
+	ing := db.newIngestorWithSeq(DefaultIngestorOpts(), tidSeq)
+
 	// use singleFreqs as source of lemmas and create indexes
 	for lemma := range singleFreqs {
-
-		err := db.bdb.Update(func(txn *badger.Txn) error {
-			if err := db.StoreLemmaTx(txn, lemma, tidSeq.next(lemma)); err != nil {
-				return err
-			}
-			return nil
-		})
-		if err != nil {
+		if err := ing.AddLemma(lemma); err != nil {
 			return fmt.Errorf("failed to store lemma: %w", err)
 		}
 	}
 
 	// Process single token frequencies
 	for lemma, lemmaFreq := range singleFreqs {
-		err := db.bdb.Update(func(txn *badger.Txn) error {
-			if err := db.StoreSingleTokenFreqTx(txn, tidSeq.recall(lemma), uint32(lemmaFreq)); err != nil {
-				return err
-			}
-			return nil
-		})
-		if err != nil {
+		if err := ing.AddSingle(lemma, uint32(lemmaFreq)); err != nil {
 			return fmt.Errorf("failed to store single freq: %w", err)
 		}
 	}
@@ -115,28 +128,21 @@ func (db *DB) StoreData(
 		if pairFreq < minPairFreq {
 			continue
 		}
-		err := db.bdb.Update(func(txn *badger.Txn) error {
-			if err := db.StorePairTokenFreqTx(
-				txn,
-				tidSeq.recall(lemmaPair[0]),
-				tidSeq.recall(lemmaPair[1]),
-				uint32(pairFreq),
-			); err != nil {
-				return err
-			}
-			return nil
-		})
-		if err != nil {
+		if err := ing.AddPair(lemmaPair[0], lemmaPair[1], uint32(pairFreq)); err != nil {
 			return fmt.Errorf("failed to store pair freq: %w", err)
 		}
 	}
 
+	if err := ing.Close(); err != nil {
+		return err
+	}
+	db.cache.invalidateAll()
 	return nil
 }
 
 // Convenience function to store or update frequency (incremental counting)
 func (db *DB) IncrementSingleTokenFreq(tokenID uint32, increment uint32) error {
-	return db.bdb.Update(func(txn *badger.Txn) error {
+	err := db.bdb.Update(func(txn *badger.Txn) error {
 		// Try to get existing frequency
 		var currentFreq uint32
 		err := db.getSingleTokenFreqTx(txn, tokenID, &currentFreq)
@@ -148,37 +154,37 @@ func (db *DB) IncrementSingleTokenFreq(tokenID uint32, increment uint32) error {
 		newFreq := currentFreq + increment
 
 		// Store updated frequency
-		key := encodeSingleTokenKey(tokenID)
+		key := tokenIDToKey(tokenID)
 		value := encodeFrequency(newFreq)
 		return txn.Set(key, value)
 	})
+	if err != nil {
+		return err
+	}
+	db.cache.invalidateAll()
+	return nil
 }
 
+// IncrementPairTokenFreq adds increment to the collocate frequency of
+// (token1ID, token2ID), creating the pair if it doesn't exist yet. It
+// updates the head lemma's bitmap index and frequency vector chunks in
+// place (see storeBitmapIndexTx), the same structures CalculateMeasures
+// and CalculateMeasuresStream read from.
 func (db *DB) IncrementPairTokenFreq(token1ID, token2ID uint32, increment uint32) error {
-	return db.bdb.Update(func(txn *badger.Txn) error {
-		key := encodePairTokenKey(token1ID, token2ID)
-
-		// Try to get existing frequency
-		var currentFreq uint32
-		item, err := txn.Get(key)
+	err := db.bdb.Update(func(txn *badger.Txn) error {
+		collocates, err := db.loadCollocatesTxn(txn, token1ID)
 		if err != nil && err != badger.ErrKeyNotFound {
-			return err
+			return fmt.Errorf("failed to load existing collocates for head %d: %w", token1ID, err)
 		}
-		if err == nil {
-			err = item.Value(func(val []byte) error {
-				currentFreq = decodeFrequency(val)
-				return nil
-			})
-			if err != nil {
-				return err
-			}
+		if collocates == nil {
+			collocates = make(map[uint32]uint32)
 		}
-
-		// Add increment
-		newFreq := currentFreq + increment
-
-		// Store updated frequency
-		value := encodeFrequency(newFreq)
-		return txn.Set(key, value)
+		collocates[token2ID] += increment
+		return db.storeBitmapIndexTx(txn, token1ID, collocates)
 	})
+	if err != nil {
+		return err
+	}
+	db.cache.invalidateAll()
+	return nil
 }